@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// authClaims is the payload carried by a bearer token.
+type authClaims struct {
+	Username string `json:"username,omitempty"` // requested name; a reserved one is honored only with Admin
+	Admin    bool   `json:"admin,omitempty"`    // authorizes reserved/admin usernames
+	Exp      int64  `json:"exp,omitempty"`      // unix seconds; 0 means no expiry
+}
+
+// authRequired reports whether the active Config has an auth mechanism
+// configured. When it doesn't, the server accepts anonymous connections,
+// matching the module's original behavior.
+func authRequired() bool {
+	cfg := getConfig()
+	return cfg.AuthSecret != "" || cfg.AuthPublicKey != ""
+}
+
+// verifyToken checks a "<payload>.<signature>" bearer token, both parts
+// base64url-encoded, against the active Config's shared secret or Ed25519
+// public key and returns its claims. It fails closed: with neither
+// configured, no token verifies.
+func verifyToken(token string) (authClaims, error) {
+	cfg := getConfig()
+
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return authClaims{}, fmt.Errorf("malformed token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return authClaims{}, fmt.Errorf("malformed token payload")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return authClaims{}, fmt.Errorf("malformed token signature")
+	}
+
+	switch {
+	case cfg.AuthPublicKey != "":
+		pub, err := base64.StdEncoding.DecodeString(cfg.AuthPublicKey)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return authClaims{}, fmt.Errorf("server has an invalid auth public key configured")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(pub), []byte(payloadPart), sig) {
+			return authClaims{}, fmt.Errorf("invalid token signature")
+		}
+	case cfg.AuthSecret != "":
+		mac := hmac.New(sha256.New, []byte(cfg.AuthSecret))
+		mac.Write([]byte(payloadPart))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return authClaims{}, fmt.Errorf("invalid token signature")
+		}
+	default:
+		return authClaims{}, fmt.Errorf("server has no auth configured")
+	}
+
+	var claims authClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return authClaims{}, fmt.Errorf("malformed token claims")
+	}
+	if claims.Exp != 0 && time.Now().Unix() > claims.Exp {
+		return authClaims{}, fmt.Errorf("token expired")
+	}
+	return claims, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kugarocks/mini-chat/unbounded"
+)
+
+// Permission levels a client can hold within a room.
+const (
+	PermOp      = "op"      // can kick users, rename rooms, lock rooms
+	PermPresent = "present" // can send and receive messages
+	PermObserve = "observe" // can receive messages but not send
+)
+
+const (
+	// writeWait is the time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// pongWait is the time allowed to read the next pong message from the
+	// peer.
+	pongWait = 60 * time.Second
+
+	// pingPeriod sends pings at this interval. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// maxMessageSize is the maximum message size allowed from the peer.
+	maxMessageSize = 8192
+)
+
+// Client represents a connected WebSocket client
+type Client struct {
+	conn *websocket.Conn
+
+	// actions is the outbound queue for this client. Unlike a fixed-size
+	// channel it never blocks or drops messages under backpressure; dead
+	// peers are instead detected via the ping/pong deadlines in writePump.
+	actions *unbounded.Channel[[]byte]
+
+	// limiter bounds how fast this client may send messages, per the
+	// rateLimit section of the active Config at connect time.
+	limiter *rateLimiter
+
+	username string
+
+	// requestedUsername and isAdmin come from a verified auth token, if
+	// any; assignUsername lets any authenticated client reclaim its own
+	// requestedUsername, but only an admin may claim a reserved name.
+	requestedUsername string
+	isAdmin           bool
+
+	rooms       map[string]bool     // rooms this client currently belongs to
+	permissions map[string][]string // room -> permissions held in that room
+}
+
+// newClient creates a Client ready to be registered with a Hub
+func newClient(conn *websocket.Conn) *Client {
+	rl := getConfig().RateLimit
+	return &Client{
+		conn:        conn,
+		actions:     unbounded.New[[]byte](),
+		limiter:     newRateLimiter(rl.MessagesPerSecond, rl.Burst),
+		rooms:       make(map[string]bool),
+		permissions: make(map[string][]string),
+	}
+}
+
+// send queues message for delivery to the client.
+func (c *Client) send(message []byte) {
+	c.actions.Push(message)
+}
+
+// hasPermission reports whether the client holds perm in room.
+func (c *Client) hasPermission(room, perm string) bool {
+	return hasPerm(c.permissions[room], perm)
+}
+
+// hasPerm reports whether perms contains perm.
+func hasPerm(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// readPump pumps messages from the WebSocket connection to the hub
+func (c *Client) readPump(hub *Hub) {
+	defer func() {
+		hub.unregister <- c
+		c.conn.Close()
+		log.Println("Connection closed for client:", hub.clientUsername(c))
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			// c.username may still be getting assigned on Hub.run's
+			// goroutine; clientUsername reads it under usersMutex rather
+			// than racing that assignment directly.
+			log.Println("Read error for client", hub.clientUsername(c), ":", err)
+			break
+		}
+		hub.incoming <- &inboundMessage{client: c, data: message}
+	}
+}
+
+// writePump pumps messages from the hub to the WebSocket connection,
+// interleaving periodic pings so dead peers are detected and dropped even
+// though the outbound queue itself never blocks.
+func (c *Client) writePump() {
+	// c.actions is closed by Hub.run once it processes this client's
+	// unregistration, which unblocks the receive below with ok == false.
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		log.Println("Connection closed for client:", c.conn.RemoteAddr())
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.actions.Ch():
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Println("Write error for client", c.conn.RemoteAddr(), ":", err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Println("Ping error for client", c.conn.RemoteAddr(), ":", err)
+				return
+			}
+		}
+	}
+}
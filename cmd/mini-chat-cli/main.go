@@ -0,0 +1,41 @@
+// Command mini-chat-cli is a terminal reference client for the mini-chat
+// server: it dials /ws and hands the connection off to a bubbletea TUI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/kugarocks/mini-chat/cmd/mini-chat-cli/tui"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "mini-chat server address (host:port)")
+	useSSL := flag.Bool("ssl", false, "dial with wss:// instead of ws://")
+	token := flag.String("token", "", "bearer token, if the server requires authentication")
+	pin := flag.String("pin", "", "base64 Ed25519 public key; embedded into the dial URL as an ?ed25519= query parameter to pin the server's TLS certificate")
+	flag.Parse()
+
+	scheme := "ws"
+	if *useSSL {
+		scheme = "wss"
+	}
+	target := url.URL{Scheme: scheme, Host: *addr, Path: "/ws"}
+	if *pin != "" {
+		q := target.Query()
+		q.Set("ed25519", *pin)
+		target.RawQuery = q.Encode()
+	}
+
+	conn, err := dial(target, *token)
+	if err != nil {
+		log.Fatal("dial ", target.String(), ": ", err)
+	}
+	defer conn.Close()
+
+	if err := tui.UI(conn); err != nil {
+		fmt.Println("mini-chat-cli exited with an error:", err)
+	}
+}
@@ -0,0 +1,399 @@
+// Package tui implements the bubbletea program behind mini-chat-cli: a
+// message log, a text input for composing, and a side panel fed by the
+// userList frames the hub already broadcasts. Commands that expect a
+// typed reply (/join, /kick, /lock, /unlock, /history) go out through
+// protocol.Perform over a wsclient.Conn so failures come back as an error
+// instead of being silently dropped; plain text is sent the same way as a
+// "message" request.
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/gorilla/websocket"
+
+	"github.com/kugarocks/mini-chat/protocol"
+	"github.com/kugarocks/mini-chat/wsclient"
+)
+
+// frame mirrors the server's bare {"type": ...} JSON messages, used for
+// unsolicited pushes (userList, kick, roomRenamed, the initial username
+// assignment, and replayed history).
+type frame map[string]interface{}
+
+// incomingMsg wraps a push frame for delivery into the bubbletea event
+// loop via tea.Program.Send.
+type incomingMsg frame
+
+// connClosedMsg signals the read loop ended, e.g. because the server
+// closed the connection or it dropped.
+type connClosedMsg struct{ err error }
+
+// commandErrMsg reports that a fire-and-forget typed request (message)
+// failed; verb names which command for the error line in the log.
+type commandErrMsg struct {
+	verb string
+	err  error
+}
+
+// joinResultMsg reports the outcome of a /join command.
+type joinResultMsg struct {
+	room  string
+	users []string
+	err   error
+}
+
+// kickResultMsg reports the outcome of a /kick command.
+type kickResultMsg struct {
+	user string
+	err  error
+}
+
+// lockResultMsg reports the outcome of a /lock or /unlock command.
+type lockResultMsg struct {
+	locked bool
+	err    error
+}
+
+// historyResultMsg reports the outcome of a /history command: an
+// oldest-first page of scrollback to prepend to the log, or an error.
+type historyResultMsg struct {
+	messages []protocol.HistoryMessage
+	err      error
+}
+
+var (
+	sideStyle = lipgloss.NewStyle().Width(20).Padding(0, 1).Border(lipgloss.NormalBorder())
+	mainStyle = lipgloss.NewStyle().Padding(0, 1)
+)
+
+// model is the bubbletea model driving the chat TUI.
+type model struct {
+	conn     *wsclient.Conn
+	viewport viewport.Model
+	input    textinput.Model
+
+	messages []string
+	users    []string
+	room     string
+	username string
+
+	// oldestID is the lowest message ID seen so far in the current room,
+	// used as the before cursor for the next /history page. 0 means no
+	// message has been seen yet.
+	oldestID uint64
+
+	err error
+}
+
+// New builds the initial model for a connection the caller has already
+// dialed and wrapped with wsclient.New.
+func New(conn *wsclient.Conn) model {
+	ti := textinput.New()
+	ti.Placeholder = "Say something... (/join, /kick, /lock, /unlock, /history)"
+	ti.Focus()
+
+	return model{
+		conn:     conn,
+		viewport: viewport.New(80, 20),
+		input:    ti,
+		room:     "lobby",
+	}
+}
+
+// UI runs the bubbletea program until the user quits or the connection
+// drops.
+func UI(ws *websocket.Conn) error {
+	conn := wsclient.New(ws)
+	p := tea.NewProgram(New(conn), tea.WithAltScreen())
+
+	conn.OnPush = func(raw []byte) {
+		var f frame
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return
+		}
+		p.Send(incomingMsg(f))
+	}
+	conn.OnClose = func(err error) {
+		p.Send(connClosedMsg{err: err})
+	}
+
+	_, err := p.Run()
+	return err
+}
+
+func (m model) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.viewport.Width = msg.Width - sideStyle.GetWidth() - 4
+		m.viewport.Height = msg.Height - 4
+		m.input.Width = m.viewport.Width
+
+	case tea.KeyMsg:
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			return m, tea.Quit
+		case tea.KeyEnter:
+			if text := strings.TrimSpace(m.input.Value()); text != "" {
+				cmds = append(cmds, m.handleInput(text))
+				m.input.SetValue("")
+			}
+		}
+
+	case incomingMsg:
+		m.applyFrame(frame(msg))
+
+	case commandErrMsg:
+		m.messages = append(m.messages, fmt.Sprintf("*** %s: %s ***", msg.verb, msg.err))
+		m.viewport.SetContent(strings.Join(m.messages, "\n"))
+		m.viewport.GotoBottom()
+
+	case joinResultMsg:
+		m.applyJoinResult(msg)
+
+	case kickResultMsg:
+		if msg.err != nil {
+			m.messages = append(m.messages, fmt.Sprintf("*** kick %s: %s ***", msg.user, msg.err))
+		} else {
+			m.messages = append(m.messages, fmt.Sprintf("*** kicked %s ***", msg.user))
+		}
+		m.viewport.SetContent(strings.Join(m.messages, "\n"))
+		m.viewport.GotoBottom()
+
+	case lockResultMsg:
+		if msg.err != nil {
+			m.messages = append(m.messages, "*** lock: "+msg.err.Error()+" ***")
+		} else if msg.locked {
+			m.messages = append(m.messages, "*** room locked ***")
+		} else {
+			m.messages = append(m.messages, "*** room unlocked ***")
+		}
+		m.viewport.SetContent(strings.Join(m.messages, "\n"))
+		m.viewport.GotoBottom()
+
+	case historyResultMsg:
+		m.applyHistoryResult(msg)
+
+	case connClosedMsg:
+		m.err = msg.err
+		return m, tea.Quit
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+	m.viewport, cmd = m.viewport.Update(msg)
+	cmds = append(cmds, cmd)
+
+	return m, tea.Batch(cmds...)
+}
+
+// handleInput turns a submitted line into the tea.Cmd that carries it out:
+// a leading "/" dispatches a typed request via Perform, anything else is
+// sent as a plain message to the current room.
+func (m *model) handleInput(text string) tea.Cmd {
+	if !strings.HasPrefix(text, "/") {
+		return performMessage(m.conn, m.room, text)
+	}
+
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case "/join":
+		if len(fields) < 2 {
+			m.messages = append(m.messages, "*** usage: /join <room> ***")
+			return nil
+		}
+		return performJoin(m.conn, fields[1])
+	case "/kick":
+		if len(fields) < 2 {
+			m.messages = append(m.messages, "*** usage: /kick <user> ***")
+			return nil
+		}
+		return performKick(m.conn, m.room, fields[1])
+	case "/lock":
+		return performLock(m.conn, m.room, true)
+	case "/unlock":
+		return performLock(m.conn, m.room, false)
+	case "/history":
+		return performHistory(m.conn, m.room, m.oldestID)
+	default:
+		m.messages = append(m.messages, "*** unknown command: "+fields[0]+" ***")
+		return nil
+	}
+}
+
+// applyFrame updates the model in response to a decoded server push: chat
+// messages append to the log, userList refreshes the side panel, kick adds
+// a notice to the log, and roomChanged/roomRenamed switch the current room.
+func (m *model) applyFrame(f frame) {
+	switch f["type"] {
+	case "username":
+		if u, ok := f["username"].(string); ok {
+			m.username = u
+		}
+	case "message":
+		user, _ := f["user"].(string)
+		text, _ := f["text"].(string)
+		m.messages = append(m.messages, fmt.Sprintf("%s: %s", user, text))
+		m.trackOldestID(f["id"])
+		m.viewport.SetContent(strings.Join(m.messages, "\n"))
+		m.viewport.GotoBottom()
+	case "userList":
+		if users, ok := f["users"].([]interface{}); ok {
+			m.users = m.users[:0]
+			for _, u := range users {
+				if s, ok := u.(string); ok {
+					m.users = append(m.users, s)
+				}
+			}
+		}
+	case "kick":
+		m.messages = append(m.messages, "*** you were kicked from the room ***")
+	case "roomChanged", "roomRenamed":
+		if to, ok := f["to"].(string); ok {
+			m.room = to
+		}
+	case "pong":
+		// keepalive acknowledged; nothing to do
+	}
+}
+
+// applyJoinResult records a /join command's outcome: the new room and its
+// current members on success, an error line otherwise.
+func (m *model) applyJoinResult(msg joinResultMsg) {
+	if msg.err != nil {
+		m.messages = append(m.messages, "*** join: "+msg.err.Error()+" ***")
+	} else {
+		m.room = msg.room
+		m.users = msg.users
+		m.oldestID = 0
+		m.messages = append(m.messages, "*** joined "+msg.room+" ***")
+	}
+	m.viewport.SetContent(strings.Join(m.messages, "\n"))
+	m.viewport.GotoBottom()
+}
+
+// applyHistoryResult prepends a /history page to the log, oldest-first, and
+// advances the before cursor for the next page.
+func (m *model) applyHistoryResult(msg historyResultMsg) {
+	switch {
+	case msg.err != nil:
+		m.messages = append(m.messages, "*** history: "+msg.err.Error()+" ***")
+	case len(msg.messages) == 0:
+		m.messages = append(m.messages, "*** no more history ***")
+	default:
+		lines := make([]string, len(msg.messages))
+		for i, hm := range msg.messages {
+			lines[i] = fmt.Sprintf("%s: %s", hm.User, hm.Text)
+			if m.oldestID == 0 || hm.ID < m.oldestID {
+				m.oldestID = hm.ID
+			}
+		}
+		m.messages = append(lines, m.messages...)
+	}
+	m.viewport.SetContent(strings.Join(m.messages, "\n"))
+}
+
+// trackOldestID updates m.oldestID from a message frame's id field, so the
+// next /history request pages strictly further back.
+func (m *model) trackOldestID(rawID interface{}) {
+	idf, ok := rawID.(float64)
+	if !ok {
+		return
+	}
+	id := uint64(idf)
+	if m.oldestID == 0 || id < m.oldestID {
+		m.oldestID = id
+	}
+}
+
+// performMessage sends text to room as a typed MessageRequest.
+func performMessage(conn *wsclient.Conn, room, text string) tea.Cmd {
+	return func() tea.Msg {
+		req := protocol.MessageRequest{
+			BaseRequest: protocol.BaseRequest{RID: conn.NextRID(), Type: "message"},
+			Room:        room,
+			Text:        text,
+		}
+		if _, err := protocol.Perform[protocol.MessageRequest, protocol.MessageResponse](conn, req); err != nil {
+			return commandErrMsg{verb: "message", err: err}
+		}
+		return nil
+	}
+}
+
+// performJoin asks the hub to add us to room.
+func performJoin(conn *wsclient.Conn, room string) tea.Cmd {
+	return func() tea.Msg {
+		req := protocol.JoinRequest{
+			BaseRequest: protocol.BaseRequest{RID: conn.NextRID(), Type: "join"},
+			Room:        room,
+		}
+		resp, err := protocol.Perform[protocol.JoinRequest, protocol.JoinResponse](conn, req)
+		if err != nil {
+			return joinResultMsg{err: err}
+		}
+		return joinResultMsg{room: resp.Room, users: resp.Users}
+	}
+}
+
+// performKick asks the hub to remove user from room.
+func performKick(conn *wsclient.Conn, room, user string) tea.Cmd {
+	return func() tea.Msg {
+		req := protocol.KickRequest{
+			BaseRequest: protocol.BaseRequest{RID: conn.NextRID(), Type: "kick"},
+			Room:        room,
+			User:        user,
+		}
+		_, err := protocol.Perform[protocol.KickRequest, protocol.KickResponse](conn, req)
+		return kickResultMsg{user: user, err: err}
+	}
+}
+
+// performLock asks the hub to lock or unlock room to new joiners.
+func performLock(conn *wsclient.Conn, room string, locked bool) tea.Cmd {
+	return func() tea.Msg {
+		req := protocol.LockRoomRequest{
+			BaseRequest: protocol.BaseRequest{RID: conn.NextRID(), Type: "lockRoom"},
+			Room:        room,
+			Locked:      locked,
+		}
+		_, err := protocol.Perform[protocol.LockRoomRequest, protocol.LockRoomResponse](conn, req)
+		return lockResultMsg{locked: locked, err: err}
+	}
+}
+
+// performHistory fetches the page of room's scrollback strictly before
+// before (or the newest page, if before is 0).
+func performHistory(conn *wsclient.Conn, room string, before uint64) tea.Cmd {
+	return func() tea.Msg {
+		req := protocol.FetchHistoryRequest{
+			BaseRequest: protocol.BaseRequest{RID: conn.NextRID(), Type: "fetchHistory"},
+			Room:        room,
+			Before:      before,
+		}
+		resp, err := protocol.Perform[protocol.FetchHistoryRequest, protocol.FetchHistoryResponse](conn, req)
+		if err != nil {
+			return historyResultMsg{err: err}
+		}
+		return historyResultMsg{messages: resp.Messages}
+	}
+}
+
+func (m model) View() string {
+	side := sideStyle.Height(m.viewport.Height).Render("Users\n" + strings.Join(m.users, "\n"))
+	main := mainStyle.Render(m.viewport.View() + "\n" + m.input.View())
+	return lipgloss.JoinHorizontal(lipgloss.Top, main, side)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/hjson/hjson-go/v4"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Config holds the server's runtime configuration. It may be reloaded at any
+// time via SIGHUP, so nothing in it should be mutated in place; swap the
+// whole value instead.
+type Config struct {
+	ListenAddr     string   `json:"listenAddr"`
+	TLSCert        string   `json:"tlsCert"`
+	TLSKey         string   `json:"tlsKey"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+	UsernamePool   []string `json:"usernamePool"`
+	MaxClients     int      `json:"maxClients"`
+
+	// HistorySize is how many past messages each room retains for replay to
+	// joiners and fetchHistory paging. Zero disables scrollback.
+	HistorySize int `json:"historySize"`
+
+	// AuthSecret and AuthPublicKey are alternative ways to verify a
+	// client's bearer token: AuthSecret for HMAC-SHA256, AuthPublicKey (a
+	// base64 Ed25519 public key) for signature verification. If neither is
+	// set, the server accepts anonymous connections as before.
+	AuthSecret    string   `json:"authSecret"`
+	AuthPublicKey string   `json:"authPublicKey"`
+	ReservedNames []string `json:"reservedNames"`
+
+	RateLimit    RateLimitConfig    `json:"rateLimit"`
+	RoomDefaults RoomDefaultsConfig `json:"roomDefaults"`
+}
+
+// RateLimitConfig bounds how fast a single client may send messages.
+type RateLimitConfig struct {
+	MessagesPerSecond float64 `json:"messagesPerSecond"`
+	Burst             int     `json:"burst"`
+}
+
+// RoomDefaultsConfig describes the room a client lands in on connect.
+type RoomDefaultsConfig struct {
+	Name   string `json:"name"`
+	Locked bool   `json:"locked"`
+}
+
+// defaultUsernamePool is used whenever a config omits usernamePool.
+var defaultUsernamePool = []string{
+	"Luffy", "Zoro", "Nami", "Usopp", "Sanji", "Chopper",
+	"Robin", "Franky", "Brook",
+}
+
+// defaultConfig returns the configuration used when no -config file is given.
+func defaultConfig() *Config {
+	return &Config{
+		UsernamePool: defaultUsernamePool,
+		HistorySize:  50,
+		RateLimit:    RateLimitConfig{MessagesPerSecond: 5, Burst: 10},
+		RoomDefaults: RoomDefaultsConfig{Name: "lobby"},
+	}
+}
+
+// currentConfig holds the live *Config behind an atomic.Value so readers
+// never block on a reload, and a SIGHUP can swap it out while existing
+// connections keep running under the config they joined with.
+var currentConfig atomic.Value
+
+func init() {
+	currentConfig.Store(defaultConfig())
+}
+
+// getConfig returns the currently active configuration.
+func getConfig() *Config {
+	return currentConfig.Load().(*Config)
+}
+
+// loadConfigFile reads and parses an HJSON config file at path, stripping
+// any UTF-16 BOM Windows editors like to leave behind and decoding to UTF-8
+// before handing the bytes to the HJSON parser.
+func loadConfigFile(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = toUTF8(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic map[string]interface{}
+	if err := hjson.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+
+	// Round-trip through encoding/json so we get its struct tag semantics
+	// rather than hjson's.
+	normalized, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if err := json.Unmarshal(normalized, cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.UsernamePool) == 0 {
+		cfg.UsernamePool = defaultUsernamePool
+	}
+	return cfg, nil
+}
+
+// toUTF8 strips a UTF-16 BOM and transcodes to UTF-8 if one is present. A
+// UTF-8 BOM is stripped; input with no BOM passes through unchanged.
+func toUTF8(raw []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}):
+		return bytes.TrimPrefix(raw, []byte{0xEF, 0xBB, 0xBF}), nil
+	case bytes.HasPrefix(raw, []byte{0xFF, 0xFE}), bytes.HasPrefix(raw, []byte{0xFE, 0xFF}):
+		decoder := unicode.BOMOverride(unicode.UTF8.NewDecoder())
+		return io.ReadAll(transform.NewReader(bytes.NewReader(raw), decoder))
+	default:
+		return raw, nil
+	}
+}
+
+// watchConfigReload installs a SIGHUP handler that reloads path into
+// currentConfig. Clients already connected are unaffected; only newly
+// registered ones see the new origin whitelist, username pool, and so on.
+func watchConfigReload(path string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			cfg, err := loadConfigFile(path)
+			if err != nil {
+				log.Println("Config reload failed, keeping previous config:", err)
+				continue
+			}
+			currentConfig.Store(cfg)
+			log.Println("Config reloaded from", path)
+		}
+	}()
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/kugarocks/mini-chat/protocol"
+)
+
+// requestHandler decodes raw into its concrete request type, applies it,
+// and returns the response to send back (with rid already set to match the
+// request). Registering a new verb is just adding an entry to
+// requestHandlers.
+type requestHandler func(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response
+
+// requestHandlers maps a frame's type to the function that handles it.
+var requestHandlers = map[string]requestHandler{
+	"message":         handleMessageRequest,
+	"join":            handleJoinRequest,
+	"leave":           handleLeaveRequest,
+	"kick":            handleKickRequest,
+	"renameRoom":      handleRenameRoomRequest,
+	"lockRoom":        handleLockRoomRequest,
+	"requestUserList": handleRequestUserListRequest,
+	"fetchHistory":    handleFetchHistoryRequest,
+	"ping":            handlePingRequest,
+}
+
+// dispatch handles a single decoded frame from a client. It always runs on
+// the Hub.run goroutine, so it may touch hub state without locking. If the
+// request carried a non-zero rid, the handler's response is sent back
+// carrying that same rid; unsolicited pushes the handler triggers along the
+// way (a broadcast message, a userList update) are sent separately with
+// rid 0.
+func (h *Hub) dispatch(c *Client, raw []byte) {
+	env, err := protocol.Decode(raw)
+	if err != nil {
+		log.Println("JSON Unmarshal error for client", c.username, ":", err)
+		return
+	}
+
+	if c.username == "" {
+		log.Println("Client has no username assigned yet")
+		return
+	}
+
+	handler, ok := requestHandlers[env.Type]
+	if !ok {
+		return
+	}
+
+	resp := handler(h, c, raw, env.RID)
+	if resp == nil || env.RID == 0 {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Failed to marshal response for client", c.username, ":", err)
+		return
+	}
+	c.send(data)
+}
+
+func handleMessageRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.MessageRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return protocol.Err(rid, "message", "malformed request")
+	}
+
+	room := req.Room
+	if room == "" {
+		room = h.defaultRoomName()
+	}
+	if !c.rooms[room] || !c.hasPermission(room, PermPresent) {
+		return protocol.Err(rid, "message", "not a member of room "+room)
+	}
+	if !c.limiter.Allow() {
+		return protocol.Err(rid, "message", "rate limited")
+	}
+
+	id := h.recordMessage(room, c.username, req.Text)
+	msgBytes, _ := json.Marshal(map[string]interface{}{
+		"type": "message",
+		"id":   id,
+		"room": room,
+		"user": c.username,
+		"text": req.Text,
+	})
+	h.broadcastToRoom(room, msgBytes)
+	return protocol.MessageResponse{BaseResponse: protocol.Ok(rid, "message")}
+}
+
+func handleJoinRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.JoinRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" {
+		return protocol.Err(rid, "join", "room is required")
+	}
+	if err := h.joinRoom(c, req.Room); err != nil {
+		return protocol.Err(rid, "join", err.Error())
+	}
+	return protocol.JoinResponse{
+		BaseResponse: protocol.Ok(rid, "join"),
+		Room:         req.Room,
+		Users:        h.roomOrder[req.Room],
+	}
+}
+
+func handleLeaveRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.LeaveRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" {
+		return protocol.Err(rid, "leave", "room is required")
+	}
+	h.leaveRoom(c, req.Room)
+	return protocol.LeaveResponse{BaseResponse: protocol.Ok(rid, "leave")}
+}
+
+func handleKickRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.KickRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" || req.User == "" {
+		return protocol.Err(rid, "kick", "room and user are required")
+	}
+	if err := h.kickUser(c, req.Room, req.User); err != nil {
+		return protocol.Err(rid, "kick", err.Error())
+	}
+	return protocol.KickResponse{BaseResponse: protocol.Ok(rid, "kick")}
+}
+
+func handleRenameRoomRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.RenameRoomRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" || req.NewName == "" {
+		return protocol.Err(rid, "renameRoom", "room and newName are required")
+	}
+	if err := h.renameRoom(c, req.Room, req.NewName); err != nil {
+		return protocol.Err(rid, "renameRoom", err.Error())
+	}
+	return protocol.RenameRoomResponse{BaseResponse: protocol.Ok(rid, "renameRoom")}
+}
+
+func handleLockRoomRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.LockRoomRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" {
+		return protocol.Err(rid, "lockRoom", "room is required")
+	}
+	if err := h.setRoomLocked(c, req.Room, req.Locked); err != nil {
+		return protocol.Err(rid, "lockRoom", err.Error())
+	}
+	return protocol.LockRoomResponse{BaseResponse: protocol.Ok(rid, "lockRoom")}
+}
+
+// handleRequestUserListRequest is a legacy, fire-and-forget verb: the
+// refreshed list is always pushed to the whole room (rid 0), not just the
+// requester, so there is no per-rid response to send back.
+func handleRequestUserListRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req struct {
+		protocol.BaseRequest
+		Room string `json:"room"`
+	}
+	_ = json.Unmarshal(raw, &req)
+
+	room := req.Room
+	if room == "" {
+		room = h.defaultRoomName()
+	}
+	h.broadcastRoomUserList(room)
+	return nil
+}
+
+func handleFetchHistoryRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	var req protocol.FetchHistoryRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.Room == "" {
+		return protocol.Err(rid, "fetchHistory", "room is required")
+	}
+	if !c.rooms[req.Room] {
+		return protocol.Err(rid, "fetchHistory", "not a member of room "+req.Room)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = getConfig().HistorySize
+	}
+
+	var entries []HistoryEntry
+	if req.Before == 0 {
+		entries = h.history.Recent(req.Room, limit)
+	} else {
+		entries = h.history.Before(req.Room, req.Before, limit)
+	}
+
+	messages := make([]protocol.HistoryMessage, len(entries))
+	for i, e := range entries {
+		messages[i] = protocol.HistoryMessage{ID: e.ID, Room: e.Room, User: e.User, Text: e.Text}
+	}
+
+	return protocol.FetchHistoryResponse{
+		BaseResponse: protocol.Ok(rid, "fetchHistory"),
+		Room:         req.Room,
+		Messages:     messages,
+	}
+}
+
+func handlePingRequest(h *Hub, c *Client, raw []byte, rid uint32) protocol.Response {
+	return protocol.PongResponse{BaseResponse: protocol.Ok(rid, "pong")}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kugarocks/mini-chat/protocol"
+)
+
+// joinedClient returns a Client already joined to room via the hub, ready
+// to be passed to a dispatch handler directly (bypassing serveWs/auth).
+func joinedClient(t *testing.T, h *Hub, room, username string) *Client {
+	t.Helper()
+	c := newClient(nil)
+	c.username = username
+	if err := h.joinRoom(c, room); err != nil {
+		t.Fatalf("joinRoom(%q, %q): %v", username, room, err)
+	}
+	return c
+}
+
+func TestHandleMessageRequestRequiresMembership(t *testing.T) {
+	h := newHub()
+	c := newClient(nil)
+	c.username = "alice"
+
+	req := protocol.MessageRequest{
+		BaseRequest: protocol.BaseRequest{RID: 1, Type: "message"},
+		Room:        "lobby",
+		Text:        "hi",
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleMessageRequest(h, c, raw, 1)
+	if resp.IsOK() {
+		t.Fatal("expected an error for a client not in the room")
+	}
+}
+
+func TestHandleMessageRequestSucceedsForMember(t *testing.T) {
+	h := newHub()
+	c := joinedClient(t, h, "lobby", "alice")
+
+	req := protocol.MessageRequest{
+		BaseRequest: protocol.BaseRequest{RID: 7, Type: "message"},
+		Room:        "lobby",
+		Text:        "hi",
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleMessageRequest(h, c, raw, 7).(protocol.MessageResponse)
+	if !resp.IsOK() {
+		t.Fatalf("expected success, got error: %s", resp.ErrorMessage())
+	}
+	if resp.GetRID() != 7 {
+		t.Fatalf("expected rid 7, got %d", resp.GetRID())
+	}
+}
+
+func TestHandleJoinRequestFirstMemberBecomesOp(t *testing.T) {
+	h := newHub()
+	c := newClient(nil)
+	c.username = "alice"
+
+	req := protocol.JoinRequest{BaseRequest: protocol.BaseRequest{RID: 1, Type: "join"}, Room: "lobby"}
+	raw, _ := json.Marshal(req)
+
+	resp := handleJoinRequest(h, c, raw, 1).(protocol.JoinResponse)
+	if !resp.IsOK() {
+		t.Fatalf("expected success, got error: %s", resp.ErrorMessage())
+	}
+	if !c.hasPermission("lobby", PermOp) {
+		t.Fatal("expected the first member of a room to become its op")
+	}
+}
+
+func TestHandleKickRequestRequiresOp(t *testing.T) {
+	h := newHub()
+	joinedClient(t, h, "lobby", "op")
+	target := joinedClient(t, h, "lobby", "target")
+	nonOp := joinedClient(t, h, "lobby", "bystander")
+
+	req := protocol.KickRequest{
+		BaseRequest: protocol.BaseRequest{RID: 1, Type: "kick"},
+		Room:        "lobby",
+		User:        "target",
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleKickRequest(h, nonOp, raw, 1)
+	if resp.IsOK() {
+		t.Fatal("expected a non-op kick to fail")
+	}
+	if !target.rooms["lobby"] {
+		t.Fatal("target should not have been removed by a failed kick")
+	}
+}
+
+func TestHandleKickRequestByOpRemovesTarget(t *testing.T) {
+	h := newHub()
+	op := joinedClient(t, h, "lobby", "op")
+	target := joinedClient(t, h, "lobby", "target")
+
+	req := protocol.KickRequest{
+		BaseRequest: protocol.BaseRequest{RID: 1, Type: "kick"},
+		Room:        "lobby",
+		User:        "target",
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleKickRequest(h, op, raw, 1).(protocol.KickResponse)
+	if !resp.IsOK() {
+		t.Fatalf("expected success, got error: %s", resp.ErrorMessage())
+	}
+	if target.rooms["lobby"] {
+		t.Fatal("expected target to have been removed from the room")
+	}
+}
+
+func TestHandleFetchHistoryRequestPagesBackwards(t *testing.T) {
+	h := newHub()
+	c := joinedClient(t, h, "lobby", "alice")
+	for i := 0; i < 5; i++ {
+		h.recordMessage("lobby", "alice", "msg")
+	}
+
+	req := protocol.FetchHistoryRequest{
+		BaseRequest: protocol.BaseRequest{RID: 1, Type: "fetchHistory"},
+		Room:        "lobby",
+		Before:      3,
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleFetchHistoryRequest(h, c, raw, 1).(protocol.FetchHistoryResponse)
+	if !resp.IsOK() {
+		t.Fatalf("expected success, got error: %s", resp.ErrorMessage())
+	}
+	for _, m := range resp.Messages {
+		if m.ID >= 3 {
+			t.Fatalf("expected all messages to have id < 3, got id %d", m.ID)
+		}
+	}
+}
+
+func TestHandleFetchHistoryRequestRequiresMembership(t *testing.T) {
+	h := newHub()
+	c := newClient(nil)
+	c.username = "alice"
+
+	req := protocol.FetchHistoryRequest{
+		BaseRequest: protocol.BaseRequest{RID: 1, Type: "fetchHistory"},
+		Room:        "lobby",
+	}
+	raw, _ := json.Marshal(req)
+
+	resp := handleFetchHistoryRequest(h, c, raw, 1)
+	if resp.IsOK() {
+		t.Fatal("expected an error for a client not in the room")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import "sync"
+
+// HistoryEntry is one stored chat message, tagged with a monotonically
+// increasing ID so clients can page backwards from a known point.
+type HistoryEntry struct {
+	ID   uint64 `json:"id"`
+	Room string `json:"room"`
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+// HistoryStore is the pluggable backing for per-room scrollback. The ring
+// buffer implementation below is the default; a persistent store could
+// implement the same interface without touching the rest of the hub.
+type HistoryStore interface {
+	// Append records entry as the newest message in room.
+	Append(room string, entry HistoryEntry)
+	// Recent returns up to n of the newest entries in room, oldest first.
+	Recent(room string, n int) []HistoryEntry
+	// Before returns up to n entries in room with ID < before, oldest first.
+	Before(room string, before uint64, n int) []HistoryEntry
+}
+
+// ringHistoryStore keeps the last size messages per room in memory.
+type ringHistoryStore struct {
+	mu    sync.Mutex
+	size  int
+	rooms map[string][]HistoryEntry // oldest first, capped at size
+}
+
+// newRingHistoryStore creates a HistoryStore that retains up to size
+// messages per room.
+func newRingHistoryStore(size int) *ringHistoryStore {
+	return &ringHistoryStore{
+		size:  size,
+		rooms: make(map[string][]HistoryEntry),
+	}
+}
+
+func (s *ringHistoryStore) Append(room string, entry HistoryEntry) {
+	if s.size <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := append(s.rooms[room], entry)
+	if len(buf) > s.size {
+		buf = buf[len(buf)-s.size:]
+	}
+	s.rooms[room] = buf
+}
+
+func (s *ringHistoryStore) Recent(room string, n int) []HistoryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.rooms[room]
+	if n <= 0 || n > len(buf) {
+		n = len(buf)
+	}
+	out := make([]HistoryEntry, n)
+	copy(out, buf[len(buf)-n:])
+	return out
+}
+
+func (s *ringHistoryStore) Before(room string, before uint64, n int) []HistoryEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := s.rooms[room]
+	end := len(buf)
+	for end > 0 && buf[end-1].ID >= before {
+		end--
+	}
+	start := end - n
+	if n <= 0 || start < 0 {
+		start = 0
+	}
+	out := make([]HistoryEntry, end-start)
+	copy(out, buf[start:end])
+	return out
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func ids(entries []HistoryEntry) []uint64 {
+	out := make([]uint64, len(entries))
+	for i, e := range entries {
+		out[i] = e.ID
+	}
+	return out
+}
+
+func sameIDs(t *testing.T, got []HistoryEntry, want []uint64) {
+	t.Helper()
+	gotIDs := ids(got)
+	if len(gotIDs) != len(want) {
+		t.Fatalf("got %v, want %v", gotIDs, want)
+	}
+	for i := range want {
+		if gotIDs[i] != want[i] {
+			t.Fatalf("got %v, want %v", gotIDs, want)
+		}
+	}
+}
+
+func TestRingHistoryStoreCapsAtSize(t *testing.T) {
+	s := newRingHistoryStore(3)
+	for i := uint64(1); i <= 5; i++ {
+		s.Append("lobby", HistoryEntry{ID: i, Room: "lobby", User: "bob", Text: "hi"})
+	}
+	sameIDs(t, s.Recent("lobby", 10), []uint64{3, 4, 5})
+}
+
+func TestRingHistoryStoreZeroSizeDisablesRetention(t *testing.T) {
+	s := newRingHistoryStore(0)
+	s.Append("lobby", HistoryEntry{ID: 1, Room: "lobby"})
+	if got := s.Recent("lobby", 10); len(got) != 0 {
+		t.Fatalf("expected no retained history, got %v", got)
+	}
+}
+
+func TestRingHistoryStoreRecentLimitsAndOrdersOldestFirst(t *testing.T) {
+	s := newRingHistoryStore(10)
+	for i := uint64(1); i <= 5; i++ {
+		s.Append("lobby", HistoryEntry{ID: i, Room: "lobby"})
+	}
+	sameIDs(t, s.Recent("lobby", 2), []uint64{4, 5})
+}
+
+func TestRingHistoryStoreBeforePaginatesBackwards(t *testing.T) {
+	s := newRingHistoryStore(10)
+	for i := uint64(1); i <= 5; i++ {
+		s.Append("lobby", HistoryEntry{ID: i, Room: "lobby"})
+	}
+
+	sameIDs(t, s.Before("lobby", 4, 10), []uint64{1, 2, 3})
+	sameIDs(t, s.Before("lobby", 4, 2), []uint64{2, 3})
+	sameIDs(t, s.Before("lobby", 1, 10), nil)
+}
+
+func TestRingHistoryStoreUnknownRoomIsEmpty(t *testing.T) {
+	s := newRingHistoryStore(10)
+	if got := s.Recent("nobody-here", 10); len(got) != 0 {
+		t.Fatalf("expected no history for unknown room, got %v", got)
+	}
+	if got := s.Before("nobody-here", 100, 10); len(got) != 0 {
+		t.Fatalf("expected no history for unknown room, got %v", got)
+	}
+}
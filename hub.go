@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// inboundMessage pairs a raw frame with the client that sent it, so reads
+// from many readPump goroutines can be serialized through Hub.run.
+type inboundMessage struct {
+	client *Client
+	data   []byte
+}
+
+// Hub maintains the set of active clients, the rooms they belong to, and
+// dispatches messages between them.
+type Hub struct {
+	clients    map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	incoming   chan *inboundMessage
+
+	userList   []string // connected usernames, in join order
+	usersMutex sync.Mutex
+
+	// clientCount mirrors len(clients) so serveWs can enforce MaxClients
+	// without reaching into Hub state from another goroutine.
+	clientCount int32
+
+	rooms     map[string]map[*Client]bool // room -> members
+	roomOrder map[string][]string         // room -> member usernames, in join order
+	locked    map[string]bool             // room -> locked to new joiners
+
+	// membership persists the permissions a username held in a room so a
+	// reconnecting client picks up where it left off.
+	membership map[string]map[string][]string // username -> room -> permissions
+
+	history   HistoryStore
+	nextMsgID uint64 // monotonic, assigned to every stored message
+}
+
+// newHub creates a new Hub instance.
+func newHub() *Hub {
+	return &Hub{
+		clients:    make(map[*Client]bool),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		incoming:   make(chan *inboundMessage),
+		userList:   make([]string, 0),
+		rooms:      make(map[string]map[*Client]bool),
+		roomOrder:  make(map[string][]string),
+		locked:     make(map[string]bool),
+		membership: make(map[string]map[string][]string),
+		history:    newRingHistoryStore(getConfig().HistorySize),
+	}
+}
+
+// defaultRoomName returns the room a client joins automatically on
+// registration, as configured.
+func (h *Hub) defaultRoomName() string {
+	if name := getConfig().RoomDefaults.Name; name != "" {
+		return name
+	}
+	return "lobby"
+}
+
+// run handles the main logic of the Hub
+func (h *Hub) run() {
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			username := h.assignUsername(client)
+			atomic.AddInt32(&h.clientCount, 1)
+			usernameMsg, _ := json.Marshal(map[string]interface{}{
+				"type":     "username",
+				"username": username,
+			})
+			client.send(usernameMsg)
+			log.Printf("Username assigned to client %s: %s", client.conn.RemoteAddr(), username)
+			if err := h.joinRoom(client, h.defaultRoomName()); err != nil {
+				log.Println("Failed to join default room for client", username, ":", err)
+			}
+		case client := <-h.unregister:
+			if _, ok := h.clients[client]; ok {
+				for room := range client.rooms {
+					h.leaveRoom(client, room)
+				}
+				delete(h.clients, client)
+				h.releaseUsername(client)
+				client.actions.Close()
+				atomic.AddInt32(&h.clientCount, -1)
+			}
+		case in := <-h.incoming:
+			h.dispatch(in.client, in.data)
+		}
+	}
+}
+
+// joinRoom admits c to room, restoring its previously held permissions if
+// it has been there before, or granting default permissions otherwise. A
+// client with no saved permissions there who joins the room while it is
+// empty (including a room every member has left) becomes its op. It fails
+// if the room is locked and c is not already an op there.
+func (h *Hub) joinRoom(c *Client, room string) error {
+	if c.rooms[room] {
+		return nil
+	}
+	perms := h.restorePermissions(c.username, room)
+	if h.locked[room] && !hasPerm(perms, PermOp) {
+		return fmt.Errorf("room %q is locked", room)
+	}
+
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+		h.locked[room] = getConfig().RoomDefaults.Locked
+	}
+	isFirstMember := len(h.rooms[room]) == 0
+	h.rooms[room][c] = true
+	h.roomOrder[room] = append(h.roomOrder[room], c.username)
+	c.rooms[room] = true
+
+	if len(perms) == 0 {
+		if isFirstMember {
+			perms = []string{PermOp, PermPresent}
+		} else {
+			perms = []string{PermPresent}
+		}
+		h.savePermissions(c.username, room, perms)
+	}
+	c.permissions[room] = perms
+
+	h.replayHistory(c, room)
+	h.broadcastRoomUserList(room)
+	return nil
+}
+
+// replayHistory sends c the room's retained scrollback, each frame marked
+// historical so the TUI can render it without re-triggering notifications.
+func (h *Hub) replayHistory(c *Client, room string) {
+	for _, entry := range h.history.Recent(room, getConfig().HistorySize) {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":       "message",
+			"id":         entry.ID,
+			"room":       entry.Room,
+			"user":       entry.User,
+			"text":       entry.Text,
+			"historical": true,
+		})
+		c.send(msg)
+	}
+}
+
+// recordMessage assigns the next monotonic message ID, stores entry in
+// room's history, and returns the ID for the caller to include on the wire.
+func (h *Hub) recordMessage(room, user, text string) uint64 {
+	h.nextMsgID++
+	h.history.Append(room, HistoryEntry{ID: h.nextMsgID, Room: room, User: user, Text: text})
+	return h.nextMsgID
+}
+
+// leaveRoom removes c from room, clearing its in-memory membership but
+// leaving its persisted permissions in place for the next join.
+func (h *Hub) leaveRoom(c *Client, room string) {
+	if members, ok := h.rooms[room]; ok {
+		delete(members, c)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+			delete(h.roomOrder, room)
+		}
+	}
+	for i, name := range h.roomOrder[room] {
+		if name == c.username {
+			h.roomOrder[room] = append(h.roomOrder[room][:i], h.roomOrder[room][i+1:]...)
+			break
+		}
+	}
+	delete(c.rooms, room)
+	delete(c.permissions, room)
+	h.broadcastRoomUserList(room)
+}
+
+// restorePermissions returns the permissions username previously held in
+// room, or nil if it has never joined.
+func (h *Hub) restorePermissions(username, room string) []string {
+	if rooms, ok := h.membership[username]; ok {
+		return rooms[room]
+	}
+	return nil
+}
+
+// savePermissions records the permissions username holds in room so they
+// survive a disconnect and rejoin.
+func (h *Hub) savePermissions(username, room string, perms []string) {
+	if h.membership[username] == nil {
+		h.membership[username] = make(map[string][]string)
+	}
+	h.membership[username][room] = perms
+}
+
+// kickUser removes target from room, provided c is an op there.
+func (h *Hub) kickUser(c *Client, room, target string) error {
+	if !c.hasPermission(room, PermOp) {
+		return fmt.Errorf("not an operator of room %q", room)
+	}
+	for member := range h.rooms[room] {
+		if member.username == target {
+			kickMsg, _ := json.Marshal(map[string]interface{}{
+				"type": "kick",
+				"room": room,
+			})
+			member.send(kickMsg)
+			h.leaveRoom(member, room)
+			return nil
+		}
+	}
+	return fmt.Errorf("user %q is not in room %q", target, room)
+}
+
+// renameRoom renames room to newName, provided c is an op in room and
+// newName is not already taken.
+func (h *Hub) renameRoom(c *Client, room, newName string) error {
+	if !c.hasPermission(room, PermOp) {
+		return fmt.Errorf("not an operator of room %q", room)
+	}
+	members, ok := h.rooms[room]
+	if !ok {
+		return fmt.Errorf("room %q does not exist", room)
+	}
+	if h.rooms[newName] != nil {
+		return fmt.Errorf("room %q already exists", newName)
+	}
+
+	h.rooms[newName] = members
+	h.roomOrder[newName] = h.roomOrder[room]
+	delete(h.rooms, room)
+	delete(h.roomOrder, room)
+	if h.locked[room] {
+		h.locked[newName] = true
+		delete(h.locked, room)
+	}
+
+	for member := range members {
+		delete(member.rooms, room)
+		member.rooms[newName] = true
+		member.permissions[newName] = member.permissions[room]
+		delete(member.permissions, room)
+		h.savePermissions(member.username, newName, member.permissions[newName])
+		renamedMsg, _ := json.Marshal(map[string]interface{}{
+			"type": "roomRenamed",
+			"from": room,
+			"to":   newName,
+		})
+		member.send(renamedMsg)
+	}
+	h.broadcastRoomUserList(newName)
+	return nil
+}
+
+// setRoomLocked toggles whether new clients may join room, provided c is an
+// op there. Existing members are unaffected.
+func (h *Hub) setRoomLocked(c *Client, room string, locked bool) error {
+	if !c.hasPermission(room, PermOp) {
+		return fmt.Errorf("not an operator of room %q", room)
+	}
+	h.locked[room] = locked
+	return nil
+}
+
+// broadcastToRoom fans message out to every member of room. The outbound
+// queue is unbounded, so a momentarily slow client never blocks delivery to
+// the rest of the room; a genuinely dead peer is instead caught by the
+// ping/pong deadline in writePump.
+func (h *Hub) broadcastToRoom(room string, message []byte) {
+	for client := range h.rooms[room] {
+		client.send(message)
+	}
+}
+
+// broadcastRoomUserList sends the current member list of room to its
+// members.
+func (h *Hub) broadcastRoomUserList(room string) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":  "userList",
+		"room":  room,
+		"users": h.roomOrder[room],
+	})
+	for client := range h.rooms[room] {
+		client.send(msg)
+	}
+}
+
+// assignUsername assigns a unique username to a client
+func (h *Hub) assignUsername(client *Client) string {
+	h.usersMutex.Lock()
+	defer h.usersMutex.Unlock()
+
+	// An authenticated client (requestedUsername only ever comes from a
+	// verified token, see serveWs) may reclaim its own username across a
+	// reconnect. Reserved names are a stricter pool reserved for admins.
+	if name := client.requestedUsername; name != "" && !h.isUsernameTaken(name) {
+		if !h.isReservedName(name) || client.isAdmin {
+			client.username = name
+			h.userList = append(h.userList, name)
+			return name
+		}
+	}
+
+	// First, try to assign an untaken basic username from the live pool, so
+	// a config reload's usernamePool takes effect on the next connection
+	// rather than only once the original pool is exhausted.
+	baseNames := getConfig().UsernamePool
+	for _, name := range baseNames {
+		if !h.isUsernameTaken(name) {
+			client.username = name
+			h.userList = append(h.userList, name)
+			return name
+		}
+	}
+
+	// If no basic usernames are available, use a name with a numeric suffix
+	for i := 1; ; i++ {
+		for _, baseName := range baseNames {
+			newUsername := fmt.Sprintf("%s-%d", baseName, i)
+			if !h.isUsernameTaken(newUsername) {
+				client.username = newUsername
+				h.userList = append(h.userList, newUsername)
+				return newUsername
+			}
+		}
+	}
+}
+
+// clientUsername reads c.username under usersMutex, the lock assignUsername
+// holds while writing it. It exists for readPump, which runs on its own
+// per-connection goroutine and so cannot read c.username directly without
+// racing a concurrent assignUsername call on Hub.run's goroutine.
+func (h *Hub) clientUsername(c *Client) string {
+	h.usersMutex.Lock()
+	defer h.usersMutex.Unlock()
+	return c.username
+}
+
+// isUsernameTaken checks if a username is already taken
+func (h *Hub) isUsernameTaken(username string) bool {
+	for _, existing := range h.userList {
+		if existing == username {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedName reports whether name is one of the configured
+// reservedNames, which only an admin-authorized client may claim.
+func (h *Hub) isReservedName(name string) bool {
+	for _, reserved := range getConfig().ReservedNames {
+		if reserved == name {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseUsername releases a username when a client disconnects
+func (h *Hub) releaseUsername(client *Client) {
+	h.usersMutex.Lock()
+	defer h.usersMutex.Unlock()
+
+	username := client.username
+	if username == "" {
+		return
+	}
+
+	for i, name := range h.userList {
+		if name == username {
+			h.userList = append(h.userList[:i], h.userList[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Transport is the minimal capability Perform needs from a connection: send
+// a framed request and block for the correlated response. Implementations
+// are expected to demultiplex frames by rid on a background read loop.
+type Transport interface {
+	Send(data []byte) error
+	Await(rid uint32) ([]byte, error)
+}
+
+// Perform marshals req, sends it over t, waits for the response carrying
+// req's rid, and decodes it into a U. It returns an error if the transport
+// fails or the response's ok field is false.
+func Perform[T Request, U Response](t Transport, req T) (U, error) {
+	var resp U
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	if err := t.Send(data); err != nil {
+		return resp, err
+	}
+
+	raw, err := t.Await(req.GetRID())
+	if err != nil {
+		return resp, err
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return resp, err
+	}
+	if !resp.IsOK() {
+		return resp, fmt.Errorf("%s: %s", req.Verb(), resp.ErrorMessage())
+	}
+	return resp, nil
+}
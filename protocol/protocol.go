@@ -0,0 +1,175 @@
+// Package protocol defines the typed request/response framing used between
+// mini-chat clients and the hub. Every client-to-server frame carries a rid
+// and a type; the server replies with a frame carrying the same rid plus
+// ok/error and a payload. Unsolicited server pushes (a broadcast message, a
+// userList update) omit rid, which decodes as 0.
+package protocol
+
+import "encoding/json"
+
+// Envelope is the minimal shape every frame carries, read off first so the
+// dispatcher knows which concrete type to decode the rest into.
+type Envelope struct {
+	RID  uint32 `json:"rid"`
+	Type string `json:"type"`
+}
+
+// Decode reads the rid/type envelope off a raw frame.
+func Decode(raw []byte) (Envelope, error) {
+	var env Envelope
+	err := json.Unmarshal(raw, &env)
+	return env, err
+}
+
+// Request is implemented by every client-to-server frame.
+type Request interface {
+	GetRID() uint32
+	Verb() string
+}
+
+// Response is implemented by every server-to-client reply frame.
+type Response interface {
+	GetRID() uint32
+	IsOK() bool
+	ErrorMessage() string
+}
+
+// BaseRequest is embedded by concrete request types for the GetRID/Verb
+// plumbing they all share.
+type BaseRequest struct {
+	RID  uint32 `json:"rid"`
+	Type string `json:"type"`
+}
+
+func (r BaseRequest) GetRID() uint32 { return r.RID }
+func (r BaseRequest) Verb() string   { return r.Type }
+
+// BaseResponse is embedded by concrete response types for the GetRID/ok/
+// error plumbing they all share.
+type BaseResponse struct {
+	RID   uint32 `json:"rid"`
+	Type  string `json:"type"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func (r BaseResponse) GetRID() uint32       { return r.RID }
+func (r BaseResponse) IsOK() bool           { return r.OK }
+func (r BaseResponse) ErrorMessage() string { return r.Error }
+
+// Ok builds a success BaseResponse for rid/typ.
+func Ok(rid uint32, typ string) BaseResponse {
+	return BaseResponse{RID: rid, Type: typ, OK: true}
+}
+
+// Err builds a failure BaseResponse for rid/typ with the given reason.
+func Err(rid uint32, typ, reason string) BaseResponse {
+	return BaseResponse{RID: rid, Type: typ, OK: false, Error: reason}
+}
+
+// JoinRequest asks the hub to add the caller to a room.
+type JoinRequest struct {
+	BaseRequest
+	Room string `json:"room"`
+}
+
+// JoinResponse reports whether the join succeeded and, if so, the room's
+// current member list.
+type JoinResponse struct {
+	BaseResponse
+	Room  string   `json:"room,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// LeaveRequest asks the hub to remove the caller from a room.
+type LeaveRequest struct {
+	BaseRequest
+	Room string `json:"room"`
+}
+
+// LeaveResponse confirms a LeaveRequest.
+type LeaveResponse struct {
+	BaseResponse
+}
+
+// MessageRequest sends text to a room.
+type MessageRequest struct {
+	BaseRequest
+	Room string `json:"room"`
+	Text string `json:"text"`
+}
+
+// MessageResponse confirms a MessageRequest was broadcast.
+type MessageResponse struct {
+	BaseResponse
+}
+
+// KickRequest asks an op to remove a user from a room.
+type KickRequest struct {
+	BaseRequest
+	Room string `json:"room"`
+	User string `json:"user"`
+}
+
+// KickResponse confirms a KickRequest.
+type KickResponse struct {
+	BaseResponse
+}
+
+// RenameRoomRequest asks an op to rename a room.
+type RenameRoomRequest struct {
+	BaseRequest
+	Room    string `json:"room"`
+	NewName string `json:"newName"`
+}
+
+// RenameRoomResponse confirms a RenameRoomRequest.
+type RenameRoomResponse struct {
+	BaseResponse
+}
+
+// LockRoomRequest asks an op to lock or unlock a room to new joiners.
+type LockRoomRequest struct {
+	BaseRequest
+	Room   string `json:"room"`
+	Locked bool   `json:"locked"`
+}
+
+// LockRoomResponse confirms a LockRoomRequest.
+type LockRoomResponse struct {
+	BaseResponse
+}
+
+// HistoryMessage is one scrollback entry returned by a FetchHistoryRequest.
+type HistoryMessage struct {
+	ID   uint64 `json:"id"`
+	Room string `json:"room"`
+	User string `json:"user"`
+	Text string `json:"text"`
+}
+
+// FetchHistoryRequest asks for a page of a room's retained scrollback,
+// oldest-first, strictly before Before (or the newest page, if Before is 0).
+type FetchHistoryRequest struct {
+	BaseRequest
+	Room   string `json:"room"`
+	Before uint64 `json:"before,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// FetchHistoryResponse carries the requested page of messages.
+type FetchHistoryResponse struct {
+	BaseResponse
+	Room     string           `json:"room,omitempty"`
+	Messages []HistoryMessage `json:"messages,omitempty"`
+}
+
+// PingRequest is a liveness check; the server replies with a PongResponse.
+type PingRequest struct {
+	BaseRequest
+}
+
+// PongResponse answers a PingRequest.
+type PongResponse struct {
+	BaseResponse
+}
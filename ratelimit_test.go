@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllowsUpToBurst(t *testing.T) {
+	rl := newRateLimiter(1, 3)
+	for i := 0; i < 3; i++ {
+		if !rl.Allow() {
+			t.Fatalf("expected Allow to succeed within burst, call %d failed", i)
+		}
+	}
+	if rl.Allow() {
+		t.Fatal("expected Allow to fail once the burst is exhausted")
+	}
+}
+
+func TestRateLimiterRefillsOverTime(t *testing.T) {
+	rl := newRateLimiter(100, 1) // 100/s refill, so ~10ms per token
+	if !rl.Allow() {
+		t.Fatal("expected the initial token to be available")
+	}
+	if rl.Allow() {
+		t.Fatal("expected the burst to be exhausted")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !rl.Allow() {
+		t.Fatal("expected a token to have refilled after waiting")
+	}
+}
+
+func TestRateLimiterNonPositiveRateDisablesLimiting(t *testing.T) {
+	rl := newRateLimiter(0, 1)
+	for i := 0; i < 100; i++ {
+		if !rl.Allow() {
+			t.Fatalf("expected Allow to always succeed with rate <= 0, call %d failed", i)
+		}
+	}
+}
+
+func TestNewRateLimiterNonPositiveBurstDefaultsToOne(t *testing.T) {
+	rl := newRateLimiter(1, 0)
+	if !rl.Allow() {
+		t.Fatal("expected at least one token to be available")
+	}
+	if rl.Allow() {
+		t.Fatal("expected the single token to be consumed")
+	}
+}
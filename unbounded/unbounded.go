@@ -0,0 +1,82 @@
+// Package unbounded provides a goroutine-safe FIFO channel with no fixed
+// capacity: pushing never blocks, the backing slice grows as needed, and
+// values are delivered to readers through a regular Go channel.
+package unbounded
+
+import "sync"
+
+// Channel is an unbounded queue of values of type T. The zero value is not
+// usable; construct one with New.
+type Channel[T any] struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []T
+	closed bool
+	out    chan T
+	done   chan struct{}
+}
+
+// New creates a Channel and starts the goroutine that feeds its output
+// channel.
+func New[T any]() *Channel[T] {
+	c := &Channel[T]{
+		out:  make(chan T),
+		done: make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.run()
+	return c
+}
+
+// run drains queued values into out, blocking only when the queue is empty.
+func (c *Channel[T]) run() {
+	defer close(c.out)
+	for {
+		c.mu.Lock()
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if len(c.queue) == 0 && c.closed {
+			c.mu.Unlock()
+			return
+		}
+		v := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		select {
+		case c.out <- v:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Push appends v to the queue. It never blocks and is a no-op once the
+// channel has been closed.
+func (c *Channel[T]) Push(v T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.queue = append(c.queue, v)
+	c.cond.Signal()
+}
+
+// Ch returns the channel values are delivered on. It is closed after Close;
+// values still queued at that point may be discarded rather than delivered.
+func (c *Channel[T]) Ch() <-chan T {
+	return c.out
+}
+
+// Close marks the channel closed: no further Push calls are accepted, and
+// the feeding goroutine stops without waiting for a reader, so values
+// already queued are not guaranteed to be delivered before out closes.
+func (c *Channel[T]) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.cond.Signal()
+	close(c.done)
+}
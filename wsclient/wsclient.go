@@ -0,0 +1,120 @@
+// Package wsclient implements protocol.Transport over a gorilla websocket
+// connection: a read loop demultiplexes incoming frames by rid, handing
+// request replies to whichever goroutine is awaiting them and unsolicited
+// pushes (rid 0) to a callback.
+package wsclient
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/kugarocks/mini-chat/protocol"
+)
+
+// Conn wraps a websocket connection with request/response correlation.
+type Conn struct {
+	ws      *websocket.Conn
+	nextRID uint32
+
+	mu      sync.Mutex
+	pending map[uint32]chan []byte
+
+	// OnPush is invoked, on the read loop's goroutine, for every frame
+	// with rid == 0 (an unsolicited server push). May be nil.
+	OnPush func(raw []byte)
+
+	// OnClose, if set, is invoked once the read loop exits, after any
+	// pending Await calls have been unblocked. err is the error that ended
+	// the read loop (e.g. from ws.ReadMessage). May be nil.
+	OnClose func(err error)
+}
+
+// New wraps ws and starts its read loop.
+func New(ws *websocket.Conn) *Conn {
+	c := &Conn{
+		ws:      ws,
+		pending: make(map[uint32]chan []byte),
+	}
+	go c.readLoop()
+	return c
+}
+
+// NextRID returns a fresh, never-repeating request id for this connection.
+func (c *Conn) NextRID() uint32 {
+	return atomic.AddUint32(&c.nextRID, 1)
+}
+
+// Send implements protocol.Transport.
+func (c *Conn) Send(data []byte) error {
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// Await implements protocol.Transport: it blocks until a frame carrying rid
+// arrives, or the connection's read loop exits.
+func (c *Conn) Await(rid uint32) ([]byte, error) {
+	ch := make(chan []byte, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("connection closed while awaiting rid %d", rid)
+	}
+	c.pending[rid] = ch
+	c.mu.Unlock()
+
+	raw, ok := <-ch
+	if !ok {
+		return nil, fmt.Errorf("connection closed while awaiting rid %d", rid)
+	}
+	return raw, nil
+}
+
+// readLoop decodes frames off ws and routes them by rid until ws errors.
+func (c *Conn) readLoop() {
+	var closeErr error
+	for {
+		_, raw, err := c.ws.ReadMessage()
+		if err != nil {
+			closeErr = err
+			break
+		}
+
+		env, err := protocol.Decode(raw)
+		if err != nil {
+			continue
+		}
+		if env.RID == 0 {
+			if c.OnPush != nil {
+				c.OnPush(raw)
+			}
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[env.RID]
+		if ok {
+			delete(c.pending, env.RID)
+		}
+		c.mu.Unlock()
+
+		if ok {
+			ch <- raw
+		}
+	}
+
+	c.closeAllPending()
+	if c.OnClose != nil {
+		c.OnClose(closeErr)
+	}
+}
+
+func (c *Conn) closeAllPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for rid, ch := range c.pending {
+		close(ch)
+		delete(c.pending, rid)
+	}
+	c.pending = nil
+}